@@ -0,0 +1,353 @@
+package cli
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/0xfe/lumen/store"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+const bootstrapVersion = "1"
+
+// bootstrapAccount is a single wallet entry in a bootstrap bundle. The
+// seed is never written in the clear: it's sealed the same way an
+// efile: store seals its pairs.
+type bootstrapAccount struct {
+	Alias         string `json:"alias"`
+	Address       string `json:"address"`
+	EncryptedSeed string `json:"encrypted_seed"`
+}
+
+// bootstrapDoc is the payload that gets Ed25519-signed. Field order
+// matters: it's what gets marshaled to compute/verify the signature, so
+// don't reorder or add fields without bumping bootstrapVersion.
+type bootstrapDoc struct {
+	Version   string             `json:"version"`
+	Network   string             `json:"network"`
+	Namespace string             `json:"namespace"`
+	Vars      map[string]string  `json:"vars"`
+	Accounts  []bootstrapAccount `json:"accounts"`
+	Assets    []string           `json:"assets"`
+}
+
+// bootstrapBundle is a bootstrapDoc plus its detached signature, as
+// written to and read from lumen.bootstrap.json.
+type bootstrapBundle struct {
+	bootstrapDoc
+	Signature string `json:"signature,omitempty"`
+}
+
+func (doc bootstrapDoc) canonicalJSON() ([]byte, error) {
+	return json.Marshal(doc)
+}
+
+func (cli *CLI) getBootstrapCmd() *cobra.Command {
+	bootstrapCmd := &cobra.Command{
+		Use:   "bootstrap",
+		Short: "create and apply portable configuration bundles",
+		Run:   cli.help,
+	}
+
+	createCmd := &cobra.Command{
+		Use:   "create",
+		Short: "snapshot the current namespace into a bootstrap bundle",
+		Args:  cobra.NoArgs,
+		Run:   cli.cmdBootstrapCreate,
+	}
+	createCmd.Flags().String("out", "lumen.bootstrap.json", "file to write the bundle to")
+	createCmd.Flags().String("sign", "", "Ed25519 private key file to sign the bundle with")
+	bootstrapCmd.AddCommand(createCmd)
+
+	importCmd := &cobra.Command{
+		Use:   "import [file]",
+		Short: "apply a bootstrap bundle to the current namespace",
+		Args:  cobra.ExactArgs(1),
+		Run:   cli.cmdBootstrapImport,
+	}
+	importCmd.Flags().String("verify", "", "Ed25519 public key file the bundle's signature must verify against")
+	bootstrapCmd.AddCommand(importCmd)
+
+	bootstrapCmd.AddCommand(&cobra.Command{
+		Use:   "diff [file]",
+		Short: "show which keys a bootstrap bundle would change",
+		Args:  cobra.ExactArgs(1),
+		Run:   cli.cmdBootstrapDiff,
+	})
+
+	return bootstrapCmd
+}
+
+func (cli *CLI) cmdBootstrapCreate(cmd *cobra.Command, args []string) {
+	out, _ := cmd.Flags().GetString("out")
+	signKeyFile, _ := cmd.Flags().GetString("sign")
+
+	doc := bootstrapDoc{
+		Version:   bootstrapVersion,
+		Namespace: cli.ns,
+		Vars:      map[string]string{},
+	}
+
+	network, err := cli.GetVar("vars:config:network")
+	if err == nil {
+		doc.Network = network
+	}
+
+	keys, err := cli.store.List(cli.ctx, cli.ns+":")
+	if err != nil {
+		showError(logrus.Fields{"type": "bootstrap", "method": "create"}, "could not list namespace: %v", err)
+		return
+	}
+
+	accountFields := map[string]map[string]string{}
+
+	for _, key := range keys {
+		relKey := strings.TrimPrefix(key, cli.ns+":")
+
+		if alias, field, ok := parseAccountKey(relKey); ok {
+			val, err := cli.store.Get(cli.ctx, key)
+			if err != nil {
+				continue
+			}
+			if accountFields[alias] == nil {
+				accountFields[alias] = map[string]string{}
+			}
+			accountFields[alias][field] = val
+			continue
+		}
+
+		val, err := cli.store.Get(cli.ctx, key)
+		if err != nil {
+			continue
+		}
+		doc.Vars[relKey] = val
+	}
+
+	if len(accountFields) > 0 {
+		passphrase, err := store.DefaultPassphraseSource()
+		if err != nil {
+			showError(logrus.Fields{"type": "bootstrap", "method": "create"}, "could not read passphrase to seal account seeds: %v", err)
+			return
+		}
+
+		aliases := make([]string, 0, len(accountFields))
+		for alias := range accountFields {
+			aliases = append(aliases, alias)
+		}
+		sort.Strings(aliases)
+
+		for _, alias := range aliases {
+			fields := accountFields[alias]
+			sealedSeed, err := store.SealSecret(fields["seed"], passphrase)
+			if err != nil {
+				showError(logrus.Fields{"type": "bootstrap", "method": "create"}, "could not seal seed for %s: %v", alias, err)
+				return
+			}
+
+			doc.Accounts = append(doc.Accounts, bootstrapAccount{
+				Alias:         alias,
+				Address:       fields["address"],
+				EncryptedSeed: sealedSeed,
+			})
+		}
+	}
+
+	bundle := bootstrapBundle{bootstrapDoc: doc}
+
+	if signKeyFile != "" {
+		keyData, err := ioutil.ReadFile(signKeyFile)
+		if err != nil {
+			showError(logrus.Fields{"type": "bootstrap", "method": "create"}, "could not read signing key: %v", err)
+			return
+		}
+
+		priv, err := parseEd25519PrivateKey(keyData)
+		if err != nil {
+			showError(logrus.Fields{"type": "bootstrap", "method": "create"}, "invalid signing key: %v", err)
+			return
+		}
+
+		payload, err := doc.canonicalJSON()
+		if err != nil {
+			showError(logrus.Fields{"type": "bootstrap", "method": "create"}, "could not serialize bundle: %v", err)
+			return
+		}
+
+		bundle.Signature = hex.EncodeToString(ed25519.Sign(priv, payload))
+	}
+
+	jsonData, err := json.MarshalIndent(bundle, "", "  ")
+	if err != nil {
+		showError(logrus.Fields{"type": "bootstrap", "method": "create"}, "could not serialize bundle: %v", err)
+		return
+	}
+
+	if err := ioutil.WriteFile(out, jsonData, 0600); err != nil {
+		showError(logrus.Fields{"type": "bootstrap", "method": "create"}, "could not write %s: %v", out, err)
+		return
+	}
+
+	fmt.Printf("wrote bootstrap bundle to %s (%d vars, %d accounts)\n", out, len(doc.Vars), len(doc.Accounts))
+}
+
+func (cli *CLI) cmdBootstrapImport(cmd *cobra.Command, args []string) {
+	bundle, err := loadBootstrapBundle(args[0])
+	if err != nil {
+		showError(logrus.Fields{"type": "bootstrap", "method": "import"}, "%v", err)
+		return
+	}
+
+	verifyKeyFile, _ := cmd.Flags().GetString("verify")
+	if verifyKeyFile != "" {
+		keyData, err := ioutil.ReadFile(verifyKeyFile)
+		if err != nil {
+			showError(logrus.Fields{"type": "bootstrap", "method": "import"}, "could not read verify key: %v", err)
+			return
+		}
+
+		pub, err := parseEd25519PublicKey(keyData)
+		if err != nil {
+			showError(logrus.Fields{"type": "bootstrap", "method": "import"}, "invalid verify key: %v", err)
+			return
+		}
+
+		if err := verifyBootstrapBundle(bundle, pub); err != nil {
+			showError(logrus.Fields{"type": "bootstrap", "method": "import"}, "signature verification failed: %v", err)
+			return
+		}
+	}
+
+	for k, v := range bundle.Vars {
+		if err := cli.SetVar(k, v); err != nil {
+			showError(logrus.Fields{"type": "bootstrap", "method": "import"}, "could not set %s: %v", k, err)
+			return
+		}
+	}
+
+	for _, account := range bundle.Accounts {
+		if err := cli.SetVar(fmt.Sprintf("accounts:%s:address", account.Alias), account.Address); err != nil {
+			showError(logrus.Fields{"type": "bootstrap", "method": "import"}, "could not set account %s: %v", account.Alias, err)
+			return
+		}
+		if err := cli.SetVar(fmt.Sprintf("accounts:%s:seed", account.Alias), account.EncryptedSeed); err != nil {
+			showError(logrus.Fields{"type": "bootstrap", "method": "import"}, "could not set account %s: %v", account.Alias, err)
+			return
+		}
+	}
+
+	fmt.Printf("imported %d vars, %d accounts from %s\n", len(bundle.Vars), len(bundle.Accounts), args[0])
+}
+
+func (cli *CLI) cmdBootstrapDiff(cmd *cobra.Command, args []string) {
+	bundle, err := loadBootstrapBundle(args[0])
+	if err != nil {
+		showError(logrus.Fields{"type": "bootstrap", "method": "diff"}, "%v", err)
+		return
+	}
+
+	want := make(map[string]string, len(bundle.Vars)+2*len(bundle.Accounts))
+	for k, v := range bundle.Vars {
+		want[k] = v
+	}
+	for _, account := range bundle.Accounts {
+		want[fmt.Sprintf("accounts:%s:address", account.Alias)] = account.Address
+		want[fmt.Sprintf("accounts:%s:seed", account.Alias)] = account.EncryptedSeed
+	}
+
+	keys := make([]string, 0, len(want))
+	for k := range want {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		newVal := want[k]
+		curVal, err := cli.GetVar(k)
+		switch {
+		case err != nil:
+			fmt.Printf("+ %s: %s\n", k, newVal)
+		case curVal != newVal:
+			fmt.Printf("~ %s: %s -> %s\n", k, curVal, newVal)
+		}
+	}
+}
+
+// parseAccountKey recognizes the "accounts:<alias>:<field>" keys SetVar
+// writes for account entries (see cmdBootstrapImport), so create can pull
+// them out of the generic var walk and seal them instead.
+func parseAccountKey(key string) (alias, field string, ok bool) {
+	const prefix = "accounts:"
+	if !strings.HasPrefix(key, prefix) {
+		return "", "", false
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(key, prefix), ":", 2)
+	if len(parts) != 2 {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
+
+func loadBootstrapBundle(path string) (*bootstrapBundle, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read %s: %v", path, err)
+	}
+
+	var bundle bootstrapBundle
+	if err := json.Unmarshal(data, &bundle); err != nil {
+		return nil, fmt.Errorf("invalid bootstrap bundle %s: %v", path, err)
+	}
+
+	return &bundle, nil
+}
+
+func verifyBootstrapBundle(bundle *bootstrapBundle, pub ed25519.PublicKey) error {
+	sig, err := hex.DecodeString(bundle.Signature)
+	if err != nil {
+		return fmt.Errorf("invalid signature encoding: %v", err)
+	}
+
+	payload, err := bundle.bootstrapDoc.canonicalJSON()
+	if err != nil {
+		return fmt.Errorf("could not serialize bundle: %v", err)
+	}
+
+	if !ed25519.Verify(pub, payload, sig) {
+		return fmt.Errorf("signature does not match bundle contents")
+	}
+
+	return nil
+}
+
+func parseEd25519PrivateKey(data []byte) (ed25519.PrivateKey, error) {
+	if len(data) != ed25519.PrivateKeySize*2 {
+		return nil, fmt.Errorf("expected %d hex-encoded bytes", ed25519.PrivateKeySize)
+	}
+
+	key := make([]byte, ed25519.PrivateKeySize)
+	if _, err := hex.Decode(key, data); err != nil {
+		return nil, err
+	}
+
+	return ed25519.PrivateKey(key), nil
+}
+
+func parseEd25519PublicKey(data []byte) (ed25519.PublicKey, error) {
+	if len(data) != ed25519.PublicKeySize*2 {
+		return nil, fmt.Errorf("expected %d hex-encoded bytes", ed25519.PublicKeySize)
+	}
+
+	key := make([]byte, ed25519.PublicKeySize)
+	if _, err := hex.Decode(key, data); err != nil {
+		return nil, err
+	}
+
+	return ed25519.PublicKey(key), nil
+}
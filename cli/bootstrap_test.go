@@ -0,0 +1,120 @@
+package cli
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"testing"
+)
+
+func TestParseAccountKey(t *testing.T) {
+	cases := []struct {
+		key       string
+		wantAlias string
+		wantField string
+		wantOK    bool
+	}{
+		{"accounts:alice:seed", "alice", "seed", true},
+		{"accounts:alice:address", "alice", "address", true},
+		{"vars:config:network", "", "", false},
+		{"accounts:bad", "", "", false},
+	}
+
+	for _, c := range cases {
+		alias, field, ok := parseAccountKey(c.key)
+		if ok != c.wantOK || alias != c.wantAlias || field != c.wantField {
+			t.Errorf("parseAccountKey(%q) = (%q, %q, %v), want (%q, %q, %v)",
+				c.key, alias, field, ok, c.wantAlias, c.wantField, c.wantOK)
+		}
+	}
+}
+
+func TestBootstrapBundleSignAndVerifyRoundTrip(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+
+	doc := bootstrapDoc{
+		Version:   bootstrapVersion,
+		Network:   "test",
+		Namespace: "default",
+		Vars:      map[string]string{"config:network": "test"},
+	}
+
+	payload, err := doc.canonicalJSON()
+	if err != nil {
+		t.Fatalf("canonicalJSON: %v", err)
+	}
+
+	bundle := &bootstrapBundle{
+		bootstrapDoc: doc,
+		Signature:    hex.EncodeToString(ed25519.Sign(priv, payload)),
+	}
+
+	if err := verifyBootstrapBundle(bundle, pub); err != nil {
+		t.Fatalf("verifyBootstrapBundle: %v", err)
+	}
+}
+
+func TestBootstrapBundleVerifyRejectsTamperedContent(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+
+	doc := bootstrapDoc{Version: bootstrapVersion, Namespace: "default", Vars: map[string]string{"k": "v"}}
+	payload, err := doc.canonicalJSON()
+	if err != nil {
+		t.Fatalf("canonicalJSON: %v", err)
+	}
+
+	bundle := &bootstrapBundle{
+		bootstrapDoc: doc,
+		Signature:    hex.EncodeToString(ed25519.Sign(priv, payload)),
+	}
+
+	bundle.Vars["k"] = "tampered"
+
+	if err := verifyBootstrapBundle(bundle, pub); err == nil {
+		t.Fatal("expected verification to fail for tampered bundle contents")
+	}
+}
+
+func TestLoadBootstrapBundleRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	path := dir + "/lumen.bootstrap.json"
+
+	want := bootstrapBundle{
+		bootstrapDoc: bootstrapDoc{
+			Version:   bootstrapVersion,
+			Namespace: "default",
+			Vars:      map[string]string{"config:network": "test"},
+			Accounts: []bootstrapAccount{
+				{Alias: "alice", Address: "GALICE", EncryptedSeed: "sealed-seed"},
+			},
+		},
+	}
+
+	jsonData, err := json.MarshalIndent(want, "", "  ")
+	if err != nil {
+		t.Fatalf("MarshalIndent: %v", err)
+	}
+	if err := ioutil.WriteFile(path, jsonData, 0600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	got, err := loadBootstrapBundle(path)
+	if err != nil {
+		t.Fatalf("loadBootstrapBundle: %v", err)
+	}
+
+	if got.Vars["config:network"] != "test" {
+		t.Errorf("Vars[config:network] = %q, want %q", got.Vars["config:network"], "test")
+	}
+	if len(got.Accounts) != 1 || got.Accounts[0].Alias != "alice" {
+		t.Errorf("Accounts = %+v, want one account aliased alice", got.Accounts)
+	}
+}
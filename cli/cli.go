@@ -2,11 +2,13 @@ package cli
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"os"
 	"strings"
 
+	"github.com/0xfe/lumen/pkg/log"
 	"github.com/0xfe/lumen/store"
 	"github.com/0xfe/microstellar"
 	"github.com/sirupsen/logrus"
@@ -19,6 +21,7 @@ type CLI struct {
 	ms      *microstellar.MicroStellar
 	ns      string // namespace
 	rootCmd *cobra.Command
+	ctx     context.Context // carries this invocation's request id
 }
 
 // NewCLI returns an initialized CLI
@@ -28,6 +31,7 @@ func NewCLI() *CLI {
 		ms:      nil,
 		ns:      "",
 		rootCmd: nil,
+		ctx:     context.Background(),
 	}
 
 	cli.init()
@@ -39,15 +43,27 @@ func (cli *CLI) help(cmd *cobra.Command, args []string) {
 }
 
 func (cli *CLI) setup(cmd *cobra.Command, args []string) {
+	cli.ctx = log.WithRequestID(context.Background(), log.NewRequestID())
+
+	logFormat, _ := cmd.Flags().GetString("log-format")
+	logFile, _ := cmd.Flags().GetString("log-file")
+	if err := log.Configure(logFormat, logFile); err != nil {
+		showError(logrus.Fields{"type": "setup"}, "could not configure logging: %v", err)
+	}
+
 	if verbose, _ := cmd.Flags().GetBool("verbose"); verbose {
 		logrus.SetLevel(logrus.DebugLevel)
 	}
 
 	env := os.Getenv("LUMEN_ENV")
 	if env != "" {
-		logrus.WithFields(logrus.Fields{"type": "setup"}).Debugf("env LUMEN_ENV: %s", env)
+		log.CLI(cli.ctx, "setup").Debugf("env LUMEN_ENV: %s", env)
 	} else {
-		logrus.WithFields(logrus.Fields{"type": "setup"}).Debugf("LUMEN_ENV not set")
+		log.CLI(cli.ctx, "setup").Debugf("LUMEN_ENV not set")
+	}
+
+	if passphraseFile, _ := cmd.Flags().GetString("passphrase-file"); passphraseFile != "" {
+		store.PassphraseFile = passphraseFile
 	}
 
 	config := readConfig(env)
@@ -56,7 +72,7 @@ func (cli *CLI) setup(cmd *cobra.Command, args []string) {
 		logrus.SetLevel(logrus.DebugLevel)
 	}
 
-	logrus.WithFields(logrus.Fields{"type": "setup"}).Debugf("using storage driver %s with %s", config.storageDriver, config.storageParams)
+	log.CLI(cli.ctx, "setup").Debugf("using storage driver %s with %s", config.storageDriver, log.RedactParams(config.storageParams))
 
 	cli.setupStore(config.storageDriver, config.storageParams)
 	cli.setupNameSpace()
@@ -65,22 +81,25 @@ func (cli *CLI) setup(cmd *cobra.Command, args []string) {
 
 func (cli *CLI) setupStore(driver, params string) {
 	if cli.rootCmd.Flag("store").Changed {
-		store, _ := cli.rootCmd.Flags().GetString("store")
-		logrus.WithFields(logrus.Fields{"type": "setup"}).Debugf("using store %s", store)
+		storeFlag, _ := cli.rootCmd.Flags().GetString("store")
 
-		parts := strings.Split(store, ":")
+		parts := strings.SplitN(storeFlag, ":", 2)
 		driver = parts[0]
-		params = parts[1]
-		logrus.WithFields(logrus.Fields{"type": "setup"}).Debugf("selecting store driver: %s params: %s", driver, params)
+		if len(parts) == 2 {
+			params = parts[1]
+		} else {
+			params = ""
+		}
+		log.CLI(cli.ctx, "setup").Debugf("selecting store driver: %s params: %s", driver, log.RedactParams(params))
 	} else {
-		logrus.WithFields(logrus.Fields{"type": "setup"}).Debugf("using default store")
+		log.CLI(cli.ctx, "setup").Debugf("using default store")
 	}
 
 	var err error
 	cli.store, err = store.NewStore(driver, params)
 
 	if err != nil {
-		showError(logrus.Fields{"type": "setup"}, "could not initialize filestore: %s:%s", driver, params)
+		showError(logrus.Fields{"type": "setup"}, "could not initialize filestore: %s:%s", driver, log.RedactParams(params))
 		return
 	}
 }
@@ -153,10 +172,15 @@ func (cli *CLI) init() {
 	rootCmd.PersistentFlags().String("network", "test", "network to use (test)")
 	rootCmd.PersistentFlags().String("ns", "default", "namespace to use (default)")
 	rootCmd.PersistentFlags().String("store", fmt.Sprintf("file:%s/.lumen-data.yml", home), "namespace to use (default)")
+	rootCmd.PersistentFlags().String("passphrase-file", "", "file containing the passphrase for an encrypted (efile:) store")
+	rootCmd.PersistentFlags().String("log-format", "text", "log output format: text or json")
+	rootCmd.PersistentFlags().String("log-file", "", "file to write logs to (default: stderr)")
 
 	rootCmd.AddCommand(cli.getPayCmd())
 	rootCmd.AddCommand(cli.getAccountCmd())
 	rootCmd.AddCommand(cli.getAssetCmd())
+	rootCmd.AddCommand(cli.getStoreCmd())
+	rootCmd.AddCommand(cli.getBootstrapCmd())
 
 	rootCmd.AddCommand(&cobra.Command{
 		Use:   "version",
@@ -203,18 +227,18 @@ func (cli *CLI) init() {
 // SetVar writes the kv pair to the storage backend
 func (cli *CLI) SetVar(key string, value string) error {
 	key = fmt.Sprintf("%s:%s", cli.ns, key)
-	logrus.WithFields(logrus.Fields{"type": "cli", "method": "SetVar"}).Debugf("setting %s: %s", key, value)
-	return cli.store.Set(key, value, 0)
+	log.CLI(cli.ctx, "SetVar").Debugf("setting %s: %s", key, log.Redact(key, value))
+	return cli.store.Set(cli.ctx, key, value, 0)
 }
 
 func (cli *CLI) GetVar(key string) (string, error) {
 	key = fmt.Sprintf("%s:%s", cli.ns, key)
-	logrus.WithFields(logrus.Fields{"type": "cli", "method": "GetVar"}).Debugf("getting %s", key)
-	return cli.store.Get(key)
+	log.CLI(cli.ctx, "GetVar").Debugf("getting %s", key)
+	return cli.store.Get(cli.ctx, key)
 }
 
 func (cli *CLI) DelVar(key string) error {
 	key = fmt.Sprintf("%s:%s", cli.ns, key)
-	logrus.WithFields(logrus.Fields{"type": "cli", "method": "DelVar"}).Debugf("deleting %s", key)
-	return cli.store.Delete(key)
+	log.CLI(cli.ctx, "DelVar").Debugf("deleting %s", key)
+	return cli.store.Delete(cli.ctx, key)
 }
\ No newline at end of file
@@ -0,0 +1,112 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/0xfe/lumen/store"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// getStoreCmd returns the "store" command group, which manages the
+// passphrase on an encrypted (efile:) backend.
+func (cli *CLI) getStoreCmd() *cobra.Command {
+	storeCmd := &cobra.Command{
+		Use:   "store",
+		Short: "manage the storage backend",
+		Run:   cli.help,
+	}
+
+	storeCmd.AddCommand(&cobra.Command{
+		Use:   "rekey",
+		Short: "rotate the passphrase on an encrypted store",
+		Args:  cobra.NoArgs,
+		Run:   cli.cmdStoreRekey,
+	})
+
+	storeCmd.AddCommand(&cobra.Command{
+		Use:   "lock",
+		Short: "drop the cached key for an encrypted store",
+		Args:  cobra.NoArgs,
+		Run:   cli.cmdStoreLock,
+	})
+
+	unlockCmd := &cobra.Command{
+		Use:   "unlock",
+		Short: "cache the key derived from the passphrase for an encrypted store",
+		Args:  cobra.NoArgs,
+		Run:   cli.cmdStoreUnlock,
+	}
+	unlockCmd.Flags().Duration("ttl", store.DefaultSessionTTL, "how long the derived key stays cached")
+	storeCmd.AddCommand(unlockCmd)
+
+	return storeCmd
+}
+
+func (cli *CLI) efileStore() (*store.EncryptedFileStore, error) {
+	efs, ok := cli.store.(*store.EncryptedFileStore)
+	if !ok {
+		return nil, fmt.Errorf("current store is not an encrypted (efile:) store")
+	}
+	return efs, nil
+}
+
+func (cli *CLI) cmdStoreRekey(cmd *cobra.Command, args []string) {
+	efs, err := cli.efileStore()
+	if err != nil {
+		showError(logrus.Fields{"type": "store", "method": "rekey"}, "%v", err)
+		return
+	}
+
+	fmt.Fprint(os.Stderr, "Enter new passphrase: ")
+	newPass, err := store.DefaultPassphraseSource()
+	if err != nil {
+		showError(logrus.Fields{"type": "store", "method": "rekey"}, "could not read new passphrase: %v", err)
+		return
+	}
+
+	if err := efs.Rekey(newPass); err != nil {
+		showError(logrus.Fields{"type": "store", "method": "rekey"}, "could not rekey store: %v", err)
+		return
+	}
+
+	fmt.Println("store rekeyed")
+}
+
+func (cli *CLI) cmdStoreLock(cmd *cobra.Command, args []string) {
+	efs, err := cli.efileStore()
+	if err != nil {
+		showError(logrus.Fields{"type": "store", "method": "lock"}, "%v", err)
+		return
+	}
+
+	if err := efs.Lock(); err != nil {
+		showError(logrus.Fields{"type": "store", "method": "lock"}, "could not clear cached key: %v", err)
+		return
+	}
+	fmt.Println("store locked")
+}
+
+func (cli *CLI) cmdStoreUnlock(cmd *cobra.Command, args []string) {
+	efs, err := cli.efileStore()
+	if err != nil {
+		showError(logrus.Fields{"type": "store", "method": "unlock"}, "%v", err)
+		return
+	}
+
+	ttl, _ := cmd.Flags().GetDuration("ttl")
+
+	pass, err := store.DefaultPassphraseSource()
+	if err != nil {
+		showError(logrus.Fields{"type": "store", "method": "unlock"}, "could not read passphrase: %v", err)
+		return
+	}
+
+	if err := efs.Unlock(pass, ttl); err != nil {
+		showError(logrus.Fields{"type": "store", "method": "unlock"}, "could not unlock store: %v", err)
+		return
+	}
+
+	fmt.Printf("store unlocked for %v\n", ttl)
+}
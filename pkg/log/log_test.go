@@ -0,0 +1,67 @@
+package log
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestRequestIDRoundTrip(t *testing.T) {
+	if got := RequestID(context.Background()); got != "-" {
+		t.Fatalf("RequestID(bare ctx) = %q, want %q", got, "-")
+	}
+
+	ctx := WithRequestID(context.Background(), "abc123")
+	if got := RequestID(ctx); got != "abc123" {
+		t.Fatalf("RequestID(ctx) = %q, want %q", got, "abc123")
+	}
+}
+
+func TestNewRequestIDIsUnique(t *testing.T) {
+	a := NewRequestID()
+	b := NewRequestID()
+	if a == b {
+		t.Fatalf("NewRequestID returned the same id twice: %q", a)
+	}
+	if len(a) == 0 {
+		t.Fatal("NewRequestID returned an empty id")
+	}
+}
+
+func TestRedactLeavesOrdinaryValuesAlone(t *testing.T) {
+	if got := Redact("balance", "42"); got != "42" {
+		t.Fatalf("Redact(balance) = %q, want unchanged value", got)
+	}
+}
+
+func TestRedactHashesSensitiveKeys(t *testing.T) {
+	for _, key := range []string{"seed", "SEED", "accounts:alice:seed", "password", "new_password", "tls"} {
+		got := Redact(key, "super-secret")
+		if got == "super-secret" {
+			t.Fatalf("Redact(%q) returned the value in the clear", key)
+		}
+		if !strings.HasPrefix(got, "sha256:") {
+			t.Fatalf("Redact(%q) = %q, want a sha256: prefix", key, got)
+		}
+	}
+}
+
+func TestRedactParams(t *testing.T) {
+	got := RedactParams("addr=localhost:6379;db=0;password=hunter2")
+	if strings.Contains(got, "hunter2") {
+		t.Fatalf("RedactParams leaked the password: %q", got)
+	}
+	if !strings.Contains(got, "addr=localhost:6379") || !strings.Contains(got, "db=0") {
+		t.Fatalf("RedactParams changed non-sensitive segments: %q", got)
+	}
+}
+
+func TestRedactParamsIgnoresMalformedSegments(t *testing.T) {
+	got := RedactParams("endpoints=host:2379;;noequals;tls=/etc/lumen/ca.pem")
+	if strings.Contains(got, "/etc/lumen/ca.pem") {
+		t.Fatalf("RedactParams left the tls path in the clear: %q", got)
+	}
+	if !strings.Contains(got, "endpoints=host:2379") {
+		t.Fatalf("RedactParams changed a non-sensitive segment: %q", got)
+	}
+}
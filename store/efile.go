@@ -0,0 +1,472 @@
+package store
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/scrypt"
+	"golang.org/x/term"
+
+	"github.com/0xfe/lumen/pkg/log"
+)
+
+const (
+	efileVersion = "1"
+	scryptN      = 32768
+	scryptR      = 8
+	scryptP      = 1
+	efileKeyLen  = 32
+	efileSaltLen = 16
+)
+
+// PassphraseSource returns the passphrase used to derive an
+// EncryptedFileStore's key. It's consulted on every open, rekey, unlock.
+type PassphraseSource func() ([]byte, error)
+
+// PassphraseFile, when set (eg. via --passphrase-file), is used when
+// LUMEN_PASSPHRASE is unset, and takes priority over the interactive prompt.
+var PassphraseFile string
+
+// DefaultPassphraseSource reads the passphrase from LUMEN_PASSPHRASE, then
+// --passphrase-file (via PassphraseFile), then falls back to an
+// interactive prompt on the terminal.
+func DefaultPassphraseSource() ([]byte, error) {
+	if pass := os.Getenv("LUMEN_PASSPHRASE"); pass != "" {
+		return []byte(pass), nil
+	}
+
+	if PassphraseFile != "" {
+		data, err := ioutil.ReadFile(PassphraseFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not read passphrase file")
+		}
+		return []byte(strings.TrimRight(string(data), "\r\n")), nil
+	}
+
+	fmt.Fprint(os.Stderr, "Enter passphrase: ")
+	pass, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not read passphrase")
+	}
+	return pass, nil
+}
+
+type kdfParams struct {
+	N    int    `json:"n"`
+	R    int    `json:"r"`
+	P    int    `json:"p"`
+	Salt []byte `json:"salt"`
+}
+
+// envelope is the on-disk format for an EncryptedFileStore: a fileData
+// blob sealed with a key derived from the user's passphrase.
+type envelope struct {
+	Version    string    `json:"version"`
+	KDFParams  kdfParams `json:"kdf_params"`
+	Nonce      []byte    `json:"nonce"`
+	Ciphertext []byte    `json:"ciphertext"`
+}
+
+func deriveKey(passphrase []byte, salt []byte) ([]byte, error) {
+	key, err := scrypt.Key(passphrase, salt, scryptN, scryptR, scryptP, efileKeyLen)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not derive key from passphrase")
+	}
+	return key, nil
+}
+
+// deriveKeyWithParams is deriveKey generalized to kdf params read back
+// from an existing envelope, in case scryptN/R/P ever change out from
+// under an already-sealed store.
+func deriveKeyWithParams(passphrase []byte, kdf kdfParams) ([]byte, error) {
+	key, err := scrypt.Key(passphrase, kdf.Salt, kdf.N, kdf.R, kdf.P, efileKeyLen)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not derive key from passphrase")
+	}
+	return key, nil
+}
+
+// newKDFParams generates a fresh salt under the current scrypt cost
+// parameters, for a new store or a Rekey.
+func newKDFParams() (kdfParams, error) {
+	salt := make([]byte, efileSaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return kdfParams{}, errors.Wrap(err, "could not generate salt")
+	}
+	return kdfParams{N: scryptN, R: scryptR, P: scryptP, Salt: salt}, nil
+}
+
+// sealEnvelopeWithKey encrypts data under key (already derived from a
+// passphrase via kdf), so callers that only have a cached key -- never
+// the passphrase itself -- can still write a new envelope.
+func sealEnvelopeWithKey(data *fileData, key []byte, kdf kdfParams) (*envelope, error) {
+	plaintext, err := json.Marshal(*data)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not marshal data")
+	}
+
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not initialize cipher")
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, errors.Wrap(err, "could not generate nonce")
+	}
+
+	return &envelope{
+		Version:    efileVersion,
+		KDFParams:  kdf,
+		Nonce:      nonce,
+		Ciphertext: aead.Seal(nil, nonce, plaintext, nil),
+	}, nil
+}
+
+// unsealEnvelopeWithKey reverses sealEnvelopeWithKey given the same
+// derived key.
+func unsealEnvelopeWithKey(env *envelope, key []byte) (*fileData, error) {
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not initialize cipher")
+	}
+
+	plaintext, err := aead.Open(nil, env.Nonce, env.Ciphertext, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "wrong passphrase or corrupt store")
+	}
+
+	data := newFileData()
+	if err := json.Unmarshal(plaintext, data); err != nil {
+		return nil, errors.Wrap(err, "could not parse decrypted data")
+	}
+
+	return data, nil
+}
+
+// SealSecret encrypts a single secret (eg. a Stellar seed) under a
+// passphrase using the same envelope format as EncryptedFileStore,
+// base64-encoded so it can be embedded in a JSON string field (see
+// bootstrapAccount.EncryptedSeed in cli/bootstrap.go).
+func SealSecret(secret string, passphrase []byte) (string, error) {
+	salt := make([]byte, efileSaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", errors.Wrap(err, "could not generate salt")
+	}
+
+	key, err := deriveKey(passphrase, salt)
+	if err != nil {
+		return "", err
+	}
+
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return "", errors.Wrap(err, "could not initialize cipher")
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", errors.Wrap(err, "could not generate nonce")
+	}
+
+	env := envelope{
+		Version: efileVersion,
+		KDFParams: kdfParams{
+			N:    scryptN,
+			R:    scryptR,
+			P:    scryptP,
+			Salt: salt,
+		},
+		Nonce:      nonce,
+		Ciphertext: aead.Seal(nil, nonce, []byte(secret), nil),
+	}
+
+	jsonData, err := json.Marshal(env)
+	if err != nil {
+		return "", errors.Wrap(err, "could not marshal sealed secret")
+	}
+
+	return base64.StdEncoding.EncodeToString(jsonData), nil
+}
+
+// UnsealSecret reverses SealSecret.
+func UnsealSecret(sealed string, passphrase []byte) (string, error) {
+	jsonData, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil {
+		return "", errors.Wrap(err, "invalid sealed secret encoding")
+	}
+
+	var env envelope
+	if err := json.Unmarshal(jsonData, &env); err != nil {
+		return "", errors.Wrap(err, "invalid sealed secret")
+	}
+
+	key, err := scrypt.Key(passphrase, env.KDFParams.Salt, env.KDFParams.N, env.KDFParams.R, env.KDFParams.P, efileKeyLen)
+	if err != nil {
+		return "", errors.Wrap(err, "could not derive key from passphrase")
+	}
+
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return "", errors.Wrap(err, "could not initialize cipher")
+	}
+
+	plaintext, err := aead.Open(nil, env.Nonce, env.Ciphertext, nil)
+	if err != nil {
+		return "", errors.Wrap(err, "wrong passphrase or corrupt secret")
+	}
+
+	return string(plaintext), nil
+}
+
+// EncryptedFileStore is a FileStore that seals its contents at rest
+// behind a passphrase-derived key, using XChaCha20-Poly1305.
+type EncryptedFileStore struct {
+	*Store
+	path      string
+	mu        *sync.RWMutex // protects data, key and kdfParams
+	data      *fileData
+	key       []byte    // AEAD key derived from the passphrase; never the passphrase itself
+	kdfParams kdfParams // salt/cost params key was derived with -- reused so later syncs don't need the passphrase again
+	source    PassphraseSource
+}
+
+// NewEncryptedFileStore opens (or creates) an encrypted store at path,
+// prompting for a passphrase via source as needed.
+func NewEncryptedFileStore(path string, source PassphraseSource) (*EncryptedFileStore, error) {
+	if source == nil {
+		source = DefaultPassphraseSource
+	}
+
+	efs := &EncryptedFileStore{
+		Store: &Store{
+			driver:     "efile",
+			parameters: path,
+		},
+		path:   path,
+		mu:     &sync.RWMutex{},
+		source: source,
+	}
+
+	raw, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		logrus.WithFields(logrus.Fields{"type": "efilestore", "method": "new"}).Infof("creating new encrypted store: %s", path)
+		pass, err := source()
+		if err != nil {
+			return nil, err
+		}
+
+		kdf, err := newKDFParams()
+		if err != nil {
+			return nil, err
+		}
+		key, err := deriveKeyWithParams(pass, kdf)
+		if err != nil {
+			return nil, err
+		}
+
+		efs.key = key
+		efs.kdfParams = kdf
+		efs.data = newFileData()
+		return efs, efs.sync()
+	} else if err != nil {
+		return nil, errors.Wrap(err, "can't read encrypted store")
+	}
+
+	var env envelope
+	if err := json.Unmarshal(raw, &env); err != nil {
+		return nil, errors.Errorf("invalid content in %s: %v", path, err)
+	}
+
+	if cachedKey, err := loadCachedKey(path); err == nil {
+		if data, err := unsealEnvelopeWithKey(&env, cachedKey); err == nil {
+			logrus.WithFields(logrus.Fields{"type": "efilestore", "method": "new"}).Debugf("using cached key for %s", path)
+			efs.key = cachedKey
+			efs.kdfParams = env.KDFParams
+			efs.data = data
+			return efs, nil
+		}
+		// Cached key doesn't open this envelope (eg. rekeyed since it was
+		// cached) -- fall through and prompt for the real passphrase.
+	}
+
+	pass, err := source()
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := deriveKeyWithParams(pass, env.KDFParams)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := unsealEnvelopeWithKey(&env, key)
+	if err != nil {
+		return nil, err
+	}
+
+	efs.key = key
+	efs.kdfParams = env.KDFParams
+	efs.data = data
+	return efs, nil
+}
+
+// sync must be called under mu. It publishes the envelope via the same
+// tmp-file+fsync+rename dance writeFileAtomic uses for the plaintext
+// store, so a crash mid-write can never truncate or corrupt the file
+// this store's secrets live in.
+func (efs *EncryptedFileStore) sync() error {
+	env, err := sealEnvelopeWithKey(efs.data, efs.key, efs.kdfParams)
+	if err != nil {
+		return err
+	}
+
+	jsonData, err := json.Marshal(env)
+	if err != nil {
+		return errors.Wrap(err, "could not marshal envelope")
+	}
+
+	logrus.WithFields(logrus.Fields{"type": "efilestore", "method": "sync"}).Debugf("writing to file: %s", efs.path)
+	return writeBytesAtomic(efs.path, jsonData)
+}
+
+func (efs *EncryptedFileStore) Set(ctx context.Context, k string, v string, ttl time.Duration) error {
+	efs.mu.Lock()
+	defer efs.mu.Unlock()
+
+	log.Store(ctx, "set", k).Debugf("writing val (ttl: %v)", ttl)
+	efs.data.Pairs[k] = fileEntry{
+		Value:     v,
+		NoExpire:  ttl == 0,
+		ExpiresOn: time.Now().Add(ttl),
+	}
+
+	efs.data.Seq++
+	return efs.sync()
+}
+
+func (efs *EncryptedFileStore) Get(ctx context.Context, k string) (string, error) {
+	efs.mu.RLock()
+	defer efs.mu.RUnlock()
+
+	val, ok := efs.data.Pairs[k]
+	if !ok || val.expired() {
+		log.Store(ctx, "get", k).Debugf("not found, expired: %v", ok && val.expired())
+		return "", errors.Errorf("not found: %s", k)
+	}
+
+	return val.Value, nil
+}
+
+func (efs *EncryptedFileStore) Delete(ctx context.Context, k string) error {
+	efs.mu.Lock()
+	defer efs.mu.Unlock()
+
+	log.Store(ctx, "delete", k).Debugf("deleting")
+	delete(efs.data.Pairs, k)
+	return efs.sync()
+}
+
+func (efs *EncryptedFileStore) List(ctx context.Context, prefix string) ([]string, error) {
+	efs.mu.RLock()
+	defer efs.mu.RUnlock()
+
+	var keys []string
+	for k, v := range efs.data.Pairs {
+		if strings.HasPrefix(k, prefix) && !v.expired() {
+			keys = append(keys, k)
+		}
+	}
+	return keys, nil
+}
+
+// Rekey re-encrypts the store under a newly supplied passphrase, rotating
+// off the one it was opened with (and its salt). Any cached key is
+// dropped since it no longer opens the store.
+func (efs *EncryptedFileStore) Rekey(newPassphrase []byte) error {
+	efs.mu.Lock()
+	defer efs.mu.Unlock()
+
+	if err := clearSessionKey(efs.path); err != nil {
+		return errors.Wrap(err, "could not clear cached key")
+	}
+
+	kdf, err := newKDFParams()
+	if err != nil {
+		return err
+	}
+	key, err := deriveKeyWithParams(newPassphrase, kdf)
+	if err != nil {
+		return err
+	}
+
+	efs.key = key
+	efs.kdfParams = kdf
+	return efs.sync()
+}
+
+// Lock drops the cached key from memory and from the on-disk session
+// cache a prior Unlock may have left behind. Set and Delete then fail
+// until Unlock (or a fresh NewEncryptedFileStore) supplies a key again;
+// Get and List still read the pairs already decrypted into memory.
+func (efs *EncryptedFileStore) Lock() error {
+	efs.mu.Lock()
+	defer efs.mu.Unlock()
+
+	for i := range efs.key {
+		efs.key[i] = 0
+	}
+	efs.key = nil
+
+	return clearSessionKey(efs.path)
+}
+
+// Unlock verifies passphrase against the on-disk envelope, then caches
+// the *derived* AEAD key -- never the passphrase itself -- both in
+// memory for the rest of this process, and on disk (sealed under a
+// machine/user-bound key, see cacheSessionKey) for ttl so later lumen
+// invocations don't re-prompt.
+func (efs *EncryptedFileStore) Unlock(passphrase []byte, ttl time.Duration) error {
+	raw, err := ioutil.ReadFile(efs.path)
+	if err != nil {
+		return errors.Wrap(err, "can't read encrypted store")
+	}
+
+	var env envelope
+	if err := json.Unmarshal(raw, &env); err != nil {
+		return errors.Errorf("invalid content in %s: %v", efs.path, err)
+	}
+
+	key, err := deriveKeyWithParams(passphrase, env.KDFParams)
+	if err != nil {
+		return err
+	}
+
+	data, err := unsealEnvelopeWithKey(&env, key)
+	if err != nil {
+		return err
+	}
+
+	if err := cacheSessionKey(efs.path, key, ttl); err != nil {
+		return errors.Wrap(err, "could not cache key")
+	}
+
+	efs.mu.Lock()
+	defer efs.mu.Unlock()
+	efs.key = key
+	efs.kdfParams = env.KDFParams
+	efs.data = data
+	return nil
+}
@@ -0,0 +1,155 @@
+package store
+
+import (
+	"context"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+)
+
+func fixedPassphraseSource(pass string) PassphraseSource {
+	return func() ([]byte, error) {
+		return []byte(pass), nil
+	}
+}
+
+func TestEncryptedFileStoreRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	path := dir + "/store.enc"
+	ctx := context.Background()
+
+	efs, err := NewEncryptedFileStore(path, fixedPassphraseSource("hunter2"))
+	if err != nil {
+		t.Fatalf("NewEncryptedFileStore: %v", err)
+	}
+
+	const secretValue = "s0very-secret-stellar-seed"
+	if err := efs.Set(ctx, "k", secretValue, 0); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+
+	// The file on disk must never contain the plaintext value.
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if strings.Contains(string(raw), secretValue) {
+		t.Fatalf("plaintext value found in envelope on disk")
+	}
+
+	reopened, err := NewEncryptedFileStore(path, fixedPassphraseSource("hunter2"))
+	if err != nil {
+		t.Fatalf("NewEncryptedFileStore (reopen): %v", err)
+	}
+
+	val, err := reopened.Get(ctx, "k")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if val != secretValue {
+		t.Fatalf("Get = %q, want %q", val, secretValue)
+	}
+}
+
+func TestEncryptedFileStoreWrongPassphraseFails(t *testing.T) {
+	dir := t.TempDir()
+	path := dir + "/store.enc"
+	ctx := context.Background()
+
+	efs, err := NewEncryptedFileStore(path, fixedPassphraseSource("hunter2"))
+	if err != nil {
+		t.Fatalf("NewEncryptedFileStore: %v", err)
+	}
+	if err := efs.Set(ctx, "k", "v", 0); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+
+	if _, err := NewEncryptedFileStore(path, fixedPassphraseSource("wrong")); err == nil {
+		t.Fatal("expected an error opening with the wrong passphrase")
+	}
+}
+
+func TestEncryptedFileStoreUnlockCachesAcrossOpen(t *testing.T) {
+	dir := t.TempDir()
+	path := dir + "/store.enc"
+	ctx := context.Background()
+
+	efs, err := NewEncryptedFileStore(path, fixedPassphraseSource("hunter2"))
+	if err != nil {
+		t.Fatalf("NewEncryptedFileStore: %v", err)
+	}
+	if err := efs.Set(ctx, "k", "v", 0); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+
+	const passphrase = "hunter2"
+	if err := efs.Unlock([]byte(passphrase), time.Hour); err != nil {
+		t.Fatalf("Unlock: %v", err)
+	}
+
+	// The on-disk session cache must never contain the passphrase, in
+	// the clear or otherwise recoverable without the machine/user-bound
+	// wrapping key.
+	sessionRaw, err := ioutil.ReadFile(sessionPathFor(path))
+	if err != nil {
+		t.Fatalf("ReadFile(session): %v", err)
+	}
+	if strings.Contains(string(sessionRaw), passphrase) {
+		t.Fatal("session cache file contains the plaintext passphrase")
+	}
+
+	// A fresh open with a passphrase source that would fail should still
+	// succeed because it picks up the cached session key instead.
+	reopened, err := NewEncryptedFileStore(path, fixedPassphraseSource("wrong"))
+	if err != nil {
+		t.Fatalf("NewEncryptedFileStore (should use cached key): %v", err)
+	}
+	if _, err := reopened.Get(ctx, "k"); err != nil {
+		t.Fatalf("Get after cached unlock: %v", err)
+	}
+
+	if err := reopened.Lock(); err != nil {
+		t.Fatalf("Lock: %v", err)
+	}
+
+	if _, err := NewEncryptedFileStore(path, fixedPassphraseSource("wrong")); err == nil {
+		t.Fatal("expected Lock to clear the cached key")
+	}
+}
+
+func TestSessionWrappingKeyIsStable(t *testing.T) {
+	a := sessionWrappingKey("/tmp/store.enc")
+	b := sessionWrappingKey("/tmp/store.enc")
+	if string(a) != string(b) {
+		t.Fatal("sessionWrappingKey is not deterministic for the same store path")
+	}
+
+	c := sessionWrappingKey("/tmp/other.enc")
+	if string(a) == string(c) {
+		t.Fatal("sessionWrappingKey should differ across store paths")
+	}
+}
+
+func TestSealSecretRoundTrip(t *testing.T) {
+	const seed = "SABCDEF0123456789STELLARSEED"
+	sealed, err := SealSecret(seed, []byte("hunter2"))
+	if err != nil {
+		t.Fatalf("SealSecret: %v", err)
+	}
+	if strings.Contains(sealed, seed) {
+		t.Fatal("sealed secret contains the plaintext seed")
+	}
+
+	got, err := UnsealSecret(sealed, []byte("hunter2"))
+	if err != nil {
+		t.Fatalf("UnsealSecret: %v", err)
+	}
+	if got != seed {
+		t.Fatalf("UnsealSecret = %q, want %q", got, seed)
+	}
+
+	if _, err := UnsealSecret(sealed, []byte("wrong")); err == nil {
+		t.Fatal("expected an error unsealing with the wrong passphrase")
+	}
+}
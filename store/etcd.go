@@ -0,0 +1,173 @@
+package store
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	clientv3 "go.etcd.io/etcd/client/v3"
+
+	"github.com/0xfe/lumen/pkg/log"
+)
+
+// EtcdStore shares state across machines through an etcd v3 cluster.
+// Params are a semicolon-separated list, eg:
+//
+//	endpoints=host:2379,host2:2379;prefix=/lumen;tls=/etc/lumen/ca.pem
+type EtcdStore struct {
+	*Store
+	client *clientv3.Client
+	prefix string
+}
+
+// NewEtcdStore dials the etcd cluster described by params and returns a
+// store namespaced under the configured prefix (default "/lumen"). If
+// params sets tls=<path to a PEM CA bundle>, the connection is made over
+// TLS, verified against that CA; otherwise the connection is plaintext.
+func NewEtcdStore(params string) (*EtcdStore, error) {
+	opts := parseStoreParams(params)
+
+	endpoints := strings.Split(opts["endpoints"], ",")
+	if len(endpoints) == 0 || endpoints[0] == "" {
+		return nil, errors.Errorf("etcd: missing endpoints in params: %s", params)
+	}
+
+	prefix := opts["prefix"]
+	if prefix == "" {
+		prefix = "/lumen"
+	}
+
+	config := clientv3.Config{
+		Endpoints:   endpoints,
+		DialTimeout: 5 * time.Second,
+	}
+
+	if caFile := opts["tls"]; caFile != "" {
+		tlsConfig, err := buildEtcdTLSConfig(caFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not configure etcd tls")
+		}
+		config.TLS = tlsConfig
+	}
+
+	client, err := clientv3.New(config)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not connect to etcd")
+	}
+
+	return &EtcdStore{
+		Store: &Store{
+			driver:     "etcd",
+			parameters: params,
+		},
+		client: client,
+		prefix: prefix,
+	}, nil
+}
+
+func (es *EtcdStore) key(k string) string {
+	return es.prefix + "/" + k
+}
+
+func (es *EtcdStore) Set(ctx context.Context, k string, v string, ttl time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	log.Store(ctx, "set", k).Debugf("writing val: %s (ttl: %v)", log.Redact(k, v), ttl)
+
+	opts := []clientv3.OpOption{}
+	if ttl > 0 {
+		lease, err := es.client.Grant(ctx, int64(ttl.Seconds()))
+		if err != nil {
+			return errors.Wrap(err, "could not create lease")
+		}
+		opts = append(opts, clientv3.WithLease(lease.ID))
+	}
+
+	_, err := es.client.Put(ctx, es.key(k), v, opts...)
+	if err != nil {
+		return errors.Wrap(err, "could not write to etcd")
+	}
+	return nil
+}
+
+func (es *EtcdStore) Get(ctx context.Context, k string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	resp, err := es.client.Get(ctx, es.key(k))
+	if err != nil {
+		return "", errors.Wrap(err, "could not read from etcd")
+	}
+
+	if len(resp.Kvs) == 0 {
+		log.Store(ctx, "get", k).Debugf("not found")
+		return "", errors.Errorf("not found: %s", k)
+	}
+
+	return string(resp.Kvs[0].Value), nil
+}
+
+func (es *EtcdStore) Delete(ctx context.Context, k string) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	log.Store(ctx, "delete", k).Debugf("deleting")
+	_, err := es.client.Delete(ctx, es.key(k))
+	if err != nil {
+		return errors.Wrap(err, "could not delete from etcd")
+	}
+	return nil
+}
+
+func (es *EtcdStore) List(ctx context.Context, prefix string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	resp, err := es.client.Get(ctx, es.key(prefix), clientv3.WithPrefix(), clientv3.WithKeysOnly())
+	if err != nil {
+		return nil, errors.Wrap(err, "could not list keys from etcd")
+	}
+
+	keys := make([]string, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		keys = append(keys, strings.TrimPrefix(string(kv.Key), es.prefix+"/"))
+	}
+	return keys, nil
+}
+
+// buildEtcdTLSConfig loads caFile as a PEM-encoded CA bundle and returns a
+// tls.Config that trusts only that bundle.
+func buildEtcdTLSConfig(caFile string) (*tls.Config, error) {
+	pem, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not read ca file")
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, errors.Errorf("no certificates found in %s", caFile)
+	}
+
+	return &tls.Config{RootCAs: pool}, nil
+}
+
+// parseStoreParams parses a "key=val;key2=val2" params string into a map.
+func parseStoreParams(params string) map[string]string {
+	opts := map[string]string{}
+	for _, part := range strings.Split(params, ";") {
+		if part == "" {
+			continue
+		}
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		opts[kv[0]] = kv[1]
+	}
+	return opts
+}
@@ -0,0 +1,25 @@
+package store
+
+import "testing"
+
+func TestNewEtcdStoreRequiresEndpoints(t *testing.T) {
+	if _, err := NewEtcdStore("prefix=/lumen"); err == nil {
+		t.Fatal("expected an error when endpoints is missing from params")
+	}
+}
+
+func TestNewEtcdStoreDefaultsPrefix(t *testing.T) {
+	es, err := NewEtcdStore("endpoints=localhost:2379")
+	if err != nil {
+		t.Fatalf("NewEtcdStore: %v", err)
+	}
+	if es.prefix != "/lumen" {
+		t.Errorf("prefix = %q, want %q", es.prefix, "/lumen")
+	}
+}
+
+func TestNewEtcdStoreRejectsUnreadableTLSCAFile(t *testing.T) {
+	if _, err := NewEtcdStore("endpoints=localhost:2379;tls=/nonexistent/ca.pem"); err == nil {
+		t.Fatal("expected an error when the tls ca file can't be read")
+	}
+}
@@ -1,18 +1,24 @@
 package store
 
 import (
+	"bufio"
+	"context"
 	"encoding/json"
 	"io/ioutil"
+	"os"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
+
+	"github.com/0xfe/lumen/pkg/log"
 )
 
 type fileEntry struct {
 	Value     string    `json:"value"`
-	NoExpire  bool      `json:"bool"`
+	NoExpire  bool      `json:"no_expire"`
 	ExpiresOn time.Time `json:"expires_on"`
 }
 
@@ -45,7 +51,7 @@ func newFileDataFromFile(fileName string) (*fileData, error) {
 	if err != nil {
 		logrus.WithFields(logrus.Fields{"type": "filestore", "method": "new"}).Debugf("read error: %v", err)
 		logrus.WithFields(logrus.Fields{"type": "filestore", "method": "new"}).Infof("creating new file: %s", fileName)
-		return fileData, fileData.sync(fileName)
+		return fileData, writeFileAtomic(fileName, fileData)
 	}
 
 	err = json.Unmarshal(data, &fileData)
@@ -58,30 +64,133 @@ func newFileDataFromFile(fileName string) (*fileData, error) {
 	return fileData, nil
 }
 
-func (data *fileData) sync(fileName string) error {
+// writeFileAtomic marshals data and publishes it to fileName via
+// writeBytesAtomic.
+func writeFileAtomic(fileName string, data *fileData) error {
 	jsonData, err := json.Marshal(*data)
-
 	if err != nil {
 		logrus.WithFields(logrus.Fields{"type": "filestore", "method": "sync"}).Errorf("marshaling error: %v", err)
 		return errors.Errorf("could not marshall json: %v", err)
 	}
 
-	logrus.WithFields(logrus.Fields{"type": "filestore", "method": "sync"}).Debugf("writing to file: %s", fileName)
-	err = ioutil.WriteFile(fileName, jsonData, 0600)
+	return writeBytesAtomic(fileName, jsonData)
+}
+
+// writeBytesAtomic publishes data to fileName without ever leaving a
+// half-written file visible: it writes to fileName+".tmp", fsyncs it,
+// then renames it over fileName (POSIX atomic replace). Shared by
+// FileStore's snapshot and EncryptedFileStore's envelope writes so both
+// backends get the same crash-safety guarantee.
+func writeBytesAtomic(fileName string, data []byte) error {
+	tmpName := fileName + ".tmp"
+	f, err := os.OpenFile(tmpName, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
 	if err != nil {
-		logrus.WithFields(logrus.Fields{"type": "filestore", "method": "sync"}).Errorf("write error: %v", err)
-		return errors.Errorf("could not write to file: %v", err)
+		return errors.Errorf("could not create snapshot: %v", err)
+	}
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return errors.Errorf("could not write snapshot: %v", err)
+	}
+
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return errors.Errorf("could not fsync snapshot: %v", err)
+	}
+
+	if err := f.Close(); err != nil {
+		return errors.Errorf("could not close snapshot: %v", err)
+	}
+
+	if err := os.Rename(tmpName, fileName); err != nil {
+		return errors.Errorf("could not publish snapshot: %v", err)
 	}
 
 	return nil
 }
 
-// DataStore represents the conntection to the Google Cloud Datastore.
+// walOp identifies the kind of mutation recorded in a walEntry.
+type walOp string
+
+const (
+	walOpSet    walOp = "set"
+	walOpDelete walOp = "delete"
+
+	// walCompactThreshold is how many WAL entries accumulate before a
+	// mutation triggers an automatic Checkpoint.
+	walCompactThreshold = 100
+)
+
+// walEntry is one line of the WAL sidecar: a single Set or Delete,
+// tagged with the Seq it produced so replay can skip anything already
+// reflected in the last snapshot. It carries the same absolute
+// NoExpire/ExpiresOn a fileEntry does (rather than a relative TTL) so
+// replay restores the original expiry instead of extending it by
+// however long the process was down.
+type walEntry struct {
+	Seq       uint64    `json:"seq"`
+	Op        walOp     `json:"op"`
+	Key       string    `json:"key"`
+	Value     string    `json:"value,omitempty"`
+	NoExpire  bool      `json:"no_expire,omitempty"`
+	ExpiresOn time.Time `json:"expires_on,omitempty"`
+}
+
+func readWAL(walPath string) ([]walEntry, error) {
+	f, err := os.Open(walPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.Errorf("could not open wal: %v", err)
+	}
+	defer f.Close()
+
+	var entries []walEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+
+		var entry walEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			// A torn trailing line means we crashed mid-append; everything
+			// before it is still valid, so stop replay here instead of
+			// failing outright.
+			logrus.WithFields(logrus.Fields{"type": "filestore", "method": "wal"}).Warnf("truncated wal entry, stopping replay: %v", err)
+			break
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+func applyWALEntry(data *fileData, entry walEntry) {
+	switch entry.Op {
+	case walOpSet:
+		data.Pairs[entry.Key] = fileEntry{
+			Value:     entry.Value,
+			NoExpire:  entry.NoExpire,
+			ExpiresOn: entry.ExpiresOn,
+		}
+	case walOpDelete:
+		delete(data.Pairs, entry.Key)
+	}
+	data.Seq = entry.Seq
+}
+
+// FileStore persists key/value pairs as a JSON snapshot on disk, backed
+// by a WAL sidecar for crash-safe mutation.
 type FileStore struct {
 	*Store
-	path string
-	mu   *sync.RWMutex // protects data
-	data *fileData
+	path      string
+	walPath   string
+	mu        *sync.RWMutex // protects data, wal, unflushed
+	data      *fileData
+	wal       *os.File
+	unflushed int // entries appended to wal since the last checkpoint
 }
 
 func NewFileStore(path string) (*FileStore, error) {
@@ -91,58 +200,166 @@ func NewFileStore(path string) (*FileStore, error) {
 		return nil, errors.Wrap(err, "can't read or create file store")
 	}
 
-	// Try to connect
 	fileStore := &FileStore{
 		Store: &Store{
 			driver:     "file",
 			parameters: path,
 		},
-		path: path,
-		mu:   &sync.RWMutex{},
-		data: fileData,
+		path:    path,
+		walPath: path + ".wal",
+		mu:      &sync.RWMutex{},
+		data:    fileData,
+	}
+
+	replayed, err := fileStore.Recover()
+	if err != nil {
+		return nil, errors.Wrap(err, "can't recover file store")
+	}
+
+	// Recover already opened a fresh wal handle via checkpointLocked when it
+	// replayed entries; only open one here if it didn't.
+	if replayed == 0 {
+		wal, err := os.OpenFile(fileStore.walPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY|os.O_SYNC, 0600)
+		if err != nil {
+			return nil, errors.Wrap(err, "can't open wal")
+		}
+		fileStore.wal = wal
 	}
+
 	return fileStore, nil
 }
 
-// sync must be called under mu
-func (fs *FileStore) sync() error {
-	return fs.data.sync(fs.path)
+// Recover replays any WAL entries written since the last snapshot and
+// folds them back into a fresh checkpoint. It can be called again at any
+// time to force the same check; it reports how many entries it replayed.
+func (fs *FileStore) Recover() (int, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	entries, err := readWAL(fs.walPath)
+	if err != nil {
+		return 0, err
+	}
+
+	replayed := 0
+	for _, entry := range entries {
+		if entry.Seq <= fs.data.Seq {
+			continue
+		}
+		applyWALEntry(fs.data, entry)
+		replayed++
+	}
+
+	if replayed == 0 {
+		return 0, nil
+	}
+
+	logrus.WithFields(logrus.Fields{"type": "filestore", "method": "recover"}).Infof("replayed %d wal entries", replayed)
+	return replayed, fs.checkpointLocked()
 }
 
-func (fs *FileStore) Set(k string, v string, ttl time.Duration) error {
+// Checkpoint forces a full snapshot to disk and truncates the WAL, rather
+// than waiting for walCompactThreshold entries to accumulate.
+func (fs *FileStore) Checkpoint() error {
 	fs.mu.Lock()
 	defer fs.mu.Unlock()
 
-	logrus.WithFields(logrus.Fields{"type": "filestore", "method": "set", "key": k}).Debugf("writing val: %s (ttl: %v)", v, ttl)
+	return fs.checkpointLocked()
+}
+
+// checkpointLocked must be called under mu.
+func (fs *FileStore) checkpointLocked() error {
+	if err := writeFileAtomic(fs.path, fs.data); err != nil {
+		return err
+	}
+
+	if fs.wal != nil {
+		if err := fs.wal.Close(); err != nil {
+			return errors.Errorf("could not close wal: %v", err)
+		}
+	}
+
+	wal, err := os.OpenFile(fs.walPath, os.O_TRUNC|os.O_CREATE|os.O_APPEND|os.O_WRONLY|os.O_SYNC, 0600)
+	if err != nil {
+		return errors.Errorf("could not reopen wal: %v", err)
+	}
+	fs.wal = wal
+	fs.unflushed = 0
+
+	return nil
+}
+
+// appendWAL must be called under mu.
+func (fs *FileStore) appendWAL(entry walEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return errors.Errorf("could not marshal wal entry: %v", err)
+	}
+	line = append(line, '\n')
+
+	if _, err := fs.wal.Write(line); err != nil {
+		return errors.Errorf("could not append to wal: %v", err)
+	}
+
+	fs.unflushed++
+	if fs.unflushed >= walCompactThreshold {
+		return fs.checkpointLocked()
+	}
+
+	return nil
+}
+
+func (fs *FileStore) Set(ctx context.Context, k string, v string, ttl time.Duration) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	log.Store(ctx, "set", k).Debugf("writing val: %s (ttl: %v)", log.Redact(k, v), ttl)
+	noExpire := ttl == 0
+	expiresOn := time.Now().Add(ttl)
 	fs.data.Pairs[k] = fileEntry{
 		Value:     v,
-		NoExpire:  ttl == 0,
-		ExpiresOn: time.Now().Add(ttl),
+		NoExpire:  noExpire,
+		ExpiresOn: expiresOn,
 	}
-
 	fs.data.Seq++
-	return fs.sync()
+
+	return fs.appendWAL(walEntry{Seq: fs.data.Seq, Op: walOpSet, Key: k, Value: v, NoExpire: noExpire, ExpiresOn: expiresOn})
 }
 
-func (fs *FileStore) Get(k string) (string, error) {
+func (fs *FileStore) Get(ctx context.Context, k string) (string, error) {
 	fs.mu.RLock()
 	defer fs.mu.RUnlock()
 
 	val, ok := fs.data.Pairs[k]
 	if !ok || val.expired() {
-		logrus.WithFields(logrus.Fields{"type": "filestore", "method": "get", "key": k}).Debugf("not found, expired: %v", ok && val.expired())
+		log.Store(ctx, "get", k).Debugf("not found, expired: %v", ok && val.expired())
 		return "", errors.Errorf("not found: %s", k)
 	}
 
-	logrus.WithFields(logrus.Fields{"type": "filestore", "method": "get", "key": k}).Debugf("got val: %s (expires: %v, expires_on: %v)", val.Value, !val.NoExpire, val.ExpiresOn)
+	log.Store(ctx, "get", k).Debugf("got val: %s (expires: %v, expires_on: %v)", log.Redact(k, val.Value), !val.NoExpire, val.ExpiresOn)
 	return val.Value, nil
 }
 
-func (fs *FileStore) Delete(k string) error {
+func (fs *FileStore) Delete(ctx context.Context, k string) error {
 	fs.mu.Lock()
 	defer fs.mu.Unlock()
 
-	logrus.WithFields(logrus.Fields{"type": "filestore", "method": "delete", "key": k}).Debugf("deleting")
+	log.Store(ctx, "delete", k).Debugf("deleting")
 	delete(fs.data.Pairs, k)
-	return fs.sync()
+	fs.data.Seq++
+
+	return fs.appendWAL(walEntry{Seq: fs.data.Seq, Op: walOpDelete, Key: k})
+}
+
+func (fs *FileStore) List(ctx context.Context, prefix string) ([]string, error) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	var keys []string
+	for k, v := range fs.data.Pairs {
+		if strings.HasPrefix(k, prefix) && !v.expired() {
+			keys = append(keys, k)
+		}
+	}
+	return keys, nil
 }
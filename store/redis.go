@@ -0,0 +1,104 @@
+package store
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/pkg/errors"
+
+	"github.com/0xfe/lumen/pkg/log"
+)
+
+// RedisStore shares state across machines through a Redis server. Params
+// are a semicolon-separated list, eg: addr=host:6379;db=0;password=secret
+type RedisStore struct {
+	*Store
+	client *redis.Client
+}
+
+// NewRedisStore dials the Redis server described by params.
+func NewRedisStore(params string) (*RedisStore, error) {
+	opts := parseStoreParams(params)
+
+	addr := opts["addr"]
+	if addr == "" {
+		return nil, errors.Errorf("redis: missing addr in params: %s", params)
+	}
+
+	db := 0
+	if dbStr := opts["db"]; dbStr != "" {
+		parsed, err := strconv.Atoi(dbStr)
+		if err != nil {
+			return nil, errors.Wrap(err, "redis: invalid db in params")
+		}
+		db = parsed
+	}
+
+	client := redis.NewClient(&redis.Options{
+		Addr:     addr,
+		Password: opts["password"],
+		DB:       db,
+	})
+
+	return &RedisStore{
+		Store: &Store{
+			driver:     "redis",
+			parameters: params,
+		},
+		client: client,
+	}, nil
+}
+
+func (rs *RedisStore) Set(ctx context.Context, k string, v string, ttl time.Duration) error {
+	log.Store(ctx, "set", k).Debugf("writing val: %s (ttl: %v)", log.Redact(k, v), ttl)
+	if err := rs.client.Set(ctx, k, v, ttl).Err(); err != nil {
+		return errors.Wrap(err, "could not write to redis")
+	}
+	return nil
+}
+
+func (rs *RedisStore) Get(ctx context.Context, k string) (string, error) {
+	val, err := rs.client.Get(ctx, k).Result()
+	if err == redis.Nil {
+		log.Store(ctx, "get", k).Debugf("not found")
+		return "", errors.Errorf("not found: %s", k)
+	} else if err != nil {
+		return "", errors.Wrap(err, "could not read from redis")
+	}
+
+	return val, nil
+}
+
+func (rs *RedisStore) Delete(ctx context.Context, k string) error {
+	log.Store(ctx, "delete", k).Debugf("deleting")
+	if err := rs.client.Del(ctx, k).Err(); err != nil {
+		return errors.Wrap(err, "could not delete from redis")
+	}
+	return nil
+}
+
+// redisScanCount is the COUNT hint passed to each SCAN cursor call: a
+// rough batch size, not a hard limit, that keeps any single call cheap on
+// a shared production Redis instead of blocking it like KEYS would.
+const redisScanCount = 100
+
+func (rs *RedisStore) List(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	var cursor uint64
+	for {
+		batch, next, err := rs.client.Scan(ctx, cursor, prefix+"*", redisScanCount).Result()
+		if err != nil {
+			return nil, errors.Wrap(err, "could not list keys from redis")
+		}
+
+		keys = append(keys, batch...)
+
+		cursor = next
+		if cursor == 0 {
+			break
+		}
+	}
+	return keys, nil
+}
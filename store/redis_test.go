@@ -0,0 +1,33 @@
+package store
+
+import "testing"
+
+func TestNewRedisStoreParsesParams(t *testing.T) {
+	rs, err := NewRedisStore("addr=localhost:6379;db=3;password=secret")
+	if err != nil {
+		t.Fatalf("NewRedisStore: %v", err)
+	}
+
+	opts := rs.client.Options()
+	if opts.Addr != "localhost:6379" {
+		t.Errorf("Addr = %q, want %q", opts.Addr, "localhost:6379")
+	}
+	if opts.DB != 3 {
+		t.Errorf("DB = %d, want %d", opts.DB, 3)
+	}
+	if opts.Password != "secret" {
+		t.Errorf("Password = %q, want %q", opts.Password, "secret")
+	}
+}
+
+func TestNewRedisStoreRequiresAddr(t *testing.T) {
+	if _, err := NewRedisStore("db=0"); err == nil {
+		t.Fatal("expected an error when addr is missing from params")
+	}
+}
+
+func TestNewRedisStoreRejectsInvalidDB(t *testing.T) {
+	if _, err := NewRedisStore("addr=localhost:6379;db=notanumber"); err == nil {
+		t.Fatal("expected an error when db is not a number")
+	}
+}
@@ -0,0 +1,126 @@
+package store
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// DefaultSessionTTL is how long `lumen store unlock` caches a derived key
+// when the caller doesn't override it with --ttl.
+const DefaultSessionTTL = 15 * time.Minute
+
+// sessionData is what gets persisted by cacheSessionKey: lumen is a
+// one-shot CLI process, so "keeping a key in memory" doesn't survive
+// past the invocation that unlocked it. Instead the store's *derived*
+// AEAD key -- never the passphrase that produced it -- is cached in a
+// sibling file, itself sealed under a key tied to this machine and
+// user (see sessionWrappingKey), so a copied .session file is useless
+// off this host or to another local user.
+type sessionData struct {
+	Nonce      []byte    `json:"nonce"`
+	Ciphertext []byte    `json:"ciphertext"`
+	ExpiresOn  time.Time `json:"expires_on"`
+}
+
+func sessionPathFor(storePath string) string {
+	return storePath + ".session"
+}
+
+// sessionWrappingKey derives the key that seals the session cache. It is
+// never itself written to disk: it's recomputed on demand from local,
+// machine- and user-bound state (the kernel's machine id and the caller's
+// uid) plus storePath, so the same .session file can't be unwrapped after
+// being copied to another host, read by another user, or moved next to a
+// different store.
+func sessionWrappingKey(storePath string) []byte {
+	machineID, err := ioutil.ReadFile("/etc/machine-id")
+	if err != nil {
+		// Not every platform has /etc/machine-id; fall back to something
+		// that's still local-only rather than failing outright.
+		machineID = []byte(os.Getenv("HOSTNAME"))
+	}
+
+	h := sha256.New()
+	h.Write(machineID)
+	fmt.Fprintf(h, ":%d:", os.Getuid())
+	h.Write([]byte(storePath))
+	return h.Sum(nil)
+}
+
+// loadCachedKey returns the store's derived key cached for storePath, or
+// an error if there's no cache, it has expired, or it can't be unwrapped
+// on this machine/user (eg. it was copied from elsewhere).
+func loadCachedKey(storePath string) ([]byte, error) {
+	raw, err := ioutil.ReadFile(sessionPathFor(storePath))
+	if err != nil {
+		return nil, err
+	}
+
+	var sess sessionData
+	if err := json.Unmarshal(raw, &sess); err != nil {
+		return nil, errors.Wrap(err, "invalid session cache")
+	}
+
+	if time.Now().After(sess.ExpiresOn) {
+		os.Remove(sessionPathFor(storePath))
+		return nil, errors.New("cached key expired")
+	}
+
+	aead, err := chacha20poly1305.NewX(sessionWrappingKey(storePath))
+	if err != nil {
+		return nil, errors.Wrap(err, "could not initialize cipher")
+	}
+
+	key, err := aead.Open(nil, sess.Nonce, sess.Ciphertext, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not unwrap cached key")
+	}
+
+	return key, nil
+}
+
+// cacheSessionKey persists the store's derived key for storePath, sealed
+// under a key tied to this machine and user, until ttl elapses. The
+// passphrase that produced key is never written to disk, and neither is
+// key itself in the clear.
+func cacheSessionKey(storePath string, key []byte, ttl time.Duration) error {
+	aead, err := chacha20poly1305.NewX(sessionWrappingKey(storePath))
+	if err != nil {
+		return errors.Wrap(err, "could not initialize cipher")
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return errors.Wrap(err, "could not generate nonce")
+	}
+
+	sess := sessionData{
+		Nonce:      nonce,
+		Ciphertext: aead.Seal(nil, nonce, key, nil),
+		ExpiresOn:  time.Now().Add(ttl),
+	}
+
+	jsonData, err := json.Marshal(sess)
+	if err != nil {
+		return errors.Wrap(err, "could not marshal session cache")
+	}
+
+	return writeBytesAtomic(sessionPathFor(storePath), jsonData)
+}
+
+// clearSessionKey removes any cached key for storePath.
+func clearSessionKey(storePath string) error {
+	err := os.Remove(sessionPathFor(storePath))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,45 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// API is the interface implemented by every storage backend (file,
+// efile, etcd, redis, ...). ctx carries the per-invocation request id
+// (see pkg/log) through to the backend's log lines.
+type API interface {
+	Set(ctx context.Context, k string, v string, ttl time.Duration) error
+	Get(ctx context.Context, k string) (string, error)
+	Delete(ctx context.Context, k string) error
+
+	// List returns every non-expired key with the given prefix.
+	List(ctx context.Context, prefix string) ([]string, error)
+}
+
+// Store holds the bits common to every backend: which driver created it
+// and the params it was configured with.
+type Store struct {
+	driver     string
+	parameters string
+}
+
+// NewStore dials up the backend named by driver, configured with params.
+// params is driver-specific: a file path for file/efile, or a
+// "key=val;key2=val2" list for etcd/redis.
+func NewStore(driver, params string) (API, error) {
+	switch driver {
+	case "file":
+		return NewFileStore(params)
+	case "efile":
+		return NewEncryptedFileStore(params, nil)
+	case "etcd":
+		return NewEtcdStore(params)
+	case "redis":
+		return NewRedisStore(params)
+	default:
+		return nil, errors.Errorf("unknown store driver: %s", driver)
+	}
+}
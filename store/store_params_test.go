@@ -0,0 +1,52 @@
+package store
+
+import "testing"
+
+func TestParseStoreParams(t *testing.T) {
+	got := parseStoreParams("endpoints=host:2379,host2:2379;prefix=/lumen;tls=/etc/lumen/ca.pem")
+	want := map[string]string{
+		"endpoints": "host:2379,host2:2379",
+		"prefix":    "/lumen",
+		"tls":       "/etc/lumen/ca.pem",
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("parseStoreParams returned %d keys, want %d: %v", len(got), len(want), got)
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("parseStoreParams[%q] = %q, want %q", k, got[k], v)
+		}
+	}
+}
+
+func TestParseStoreParamsIgnoresMalformedParts(t *testing.T) {
+	got := parseStoreParams("addr=localhost:6379;;noequals;db=1")
+	if got["addr"] != "localhost:6379" {
+		t.Errorf("addr = %q, want %q", got["addr"], "localhost:6379")
+	}
+	if got["db"] != "1" {
+		t.Errorf("db = %q, want %q", got["db"], "1")
+	}
+	if _, ok := got["noequals"]; ok {
+		t.Errorf("expected the malformed \"noequals\" part to be dropped")
+	}
+}
+
+func TestBuildEtcdTLSConfigRejectsMissingFile(t *testing.T) {
+	if _, err := buildEtcdTLSConfig("/nonexistent/ca.pem"); err == nil {
+		t.Fatal("expected an error reading a nonexistent ca file")
+	}
+}
+
+func TestBuildEtcdTLSConfigRejectsInvalidPEM(t *testing.T) {
+	dir := t.TempDir()
+	path := dir + "/ca.pem"
+	if err := writeBytesAtomic(path, []byte("not a certificate")); err != nil {
+		t.Fatalf("writeBytesAtomic: %v", err)
+	}
+
+	if _, err := buildEtcdTLSConfig(path); err == nil {
+		t.Fatal("expected an error parsing a ca file with no certificates")
+	}
+}